@@ -0,0 +1,30 @@
+package ssh
+
+import "net"
+
+// SetAgentListener registers l as the agent-forwarding listener associated
+// with this session (typically the net.Listener returned by
+// NewAgentListener, right before handing it to ForwardAgentConnections), so
+// the session has something to close if the handler itself forgets to.
+func (sess *session) SetAgentListener(l net.Listener) {
+	sess.agentListenerMu.Lock()
+	sess.agentListener = l
+	sess.agentListenerMu.Unlock()
+}
+
+// closeAgentListener closes the listener sess.SetAgentListener registered,
+// if any. It's called once a session that had agent forwarding accepted
+// exits, guaranteeing the listener's socket doesn't outlive the session
+// even when the handler that created it never closes it.
+func closeAgentListener(sess Session) {
+	s, ok := sess.(*session)
+	if !ok {
+		return
+	}
+	s.agentListenerMu.Lock()
+	l := s.agentListener
+	s.agentListenerMu.Unlock()
+	if l != nil {
+		l.Close()
+	}
+}
@@ -0,0 +1,222 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"net"
+	"sync"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// dialAgentForwardingSession sets up a real, in-memory SSH client/server
+// connection (a loopback TCP connection under a real handshake, no mocked
+// transport) and wires sess.Channel to the server's end of a "session"
+// channel opened over it, running sess.handleRequests against the real
+// *gossh.Request stream. It returns the client's end of that channel, so a
+// test can SendRequest(..., true, ...) and observe the actual wire-level
+// reply: req.Reply is a no-op unless the request that reached it had
+// WantReply set and came from a real channel, which a bare
+// &gossh.Request{Type: ...} built by hand does not.
+func dialAgentForwardingSession(t *testing.T, sess *session) gossh.Channel {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("NewSignerFromKey: %v", err)
+	}
+	serverConfig := &gossh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+	clientConfig := &gossh.ClientConfig{HostKeyCallback: gossh.InsecureIgnoreHostKey()}
+
+	// A real loopback TCP listener, not net.Pipe: the version exchange at
+	// the start of the handshake has both sides write before either reads,
+	// which deadlocks on net.Pipe's unbuffered, fully synchronous Write.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	type accepted struct {
+		channel gossh.Channel
+		reqs    <-chan *gossh.Request
+	}
+	serverDone := make(chan accepted, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		_, chans, globalReqs, err := gossh.NewServerConn(conn, serverConfig)
+		if err != nil {
+			t.Errorf("NewServerConn: %v", err)
+			return
+		}
+		go gossh.DiscardRequests(globalReqs)
+		newChan := <-chans
+		channel, reqs, err := newChan.Accept()
+		if err != nil {
+			t.Errorf("Accept: %v", err)
+			return
+		}
+		serverDone <- accepted{channel: channel, reqs: reqs}
+	}()
+
+	clientConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial: %v", err)
+	}
+	client, chans, reqs, err := gossh.NewClientConn(clientConn, "", clientConfig)
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	go gossh.DiscardRequests(reqs)
+	go func() {
+		for nc := range chans {
+			nc.Reject(gossh.UnknownChannelType, "unexpected channel")
+		}
+	}()
+
+	clientChannel, clientReqs, err := client.OpenChannel("session", nil)
+	if err != nil {
+		t.Fatalf("OpenChannel: %v", err)
+	}
+	go gossh.DiscardRequests(clientReqs)
+
+	result := <-serverDone
+	sess.Channel = result.channel
+	go sess.handleRequests(result.reqs)
+
+	t.Cleanup(func() {
+		clientChannel.Close()
+		client.Close()
+	})
+
+	return clientChannel
+}
+
+// TestAgentForwardingDeniedByDefault checks that an auth-agent-req is
+// rejected when no AgentForwardingCallback is configured, matching the
+// default-deny policy: the client sees a failed reply on the wire, and the
+// session never records itself as having agent forwarding.
+func TestAgentForwardingDeniedByDefault(t *testing.T) {
+	sess := &session{}
+	clientChannel := dialAgentForwardingSession(t, sess)
+
+	ok, err := clientChannel.SendRequest(agentRequestType, true, nil)
+	if err != nil {
+		t.Fatalf("SendRequest: %v", err)
+	}
+	if ok {
+		t.Fatal("client should see a failed reply when no callback is configured")
+	}
+	if sess.AgentForwarded() {
+		t.Fatal("AgentForwarded() should be false when no callback is configured")
+	}
+}
+
+// TestAgentForwardingDeniedByCallback checks that a callback returning false
+// denies the request: the client sees a failed reply on the wire, and
+// AgentForwarded() stays false, i.e. the client's request was failed rather
+// than silently accepted.
+func TestAgentForwardingDeniedByCallback(t *testing.T) {
+	sess := &session{
+		agentForwardingCb: func(ctx Context) bool { return false },
+	}
+	clientChannel := dialAgentForwardingSession(t, sess)
+
+	ok, err := clientChannel.SendRequest(agentRequestType, true, nil)
+	if err != nil {
+		t.Fatalf("SendRequest: %v", err)
+	}
+	if ok {
+		t.Fatal("client should see a failed reply when the callback denies the request")
+	}
+	if sess.AgentForwarded() {
+		t.Fatal("AgentForwarded() should be false when the callback denies the request")
+	}
+}
+
+// TestAgentForwardingAcceptedByCallback checks the accept path sets
+// AgentForwarded() so handlers can observe it, and that the client sees a
+// successful reply on the wire.
+func TestAgentForwardingAcceptedByCallback(t *testing.T) {
+	sess := &session{
+		agentForwardingCb: func(ctx Context) bool { return true },
+	}
+	clientChannel := dialAgentForwardingSession(t, sess)
+
+	ok, err := clientChannel.SendRequest(agentRequestType, true, nil)
+	if err != nil {
+		t.Fatalf("SendRequest: %v", err)
+	}
+	if !ok {
+		t.Fatal("client should see a successful reply once the callback accepts the request")
+	}
+	if !sess.AgentForwarded() {
+		t.Fatal("AgentForwarded() should be true once the callback accepts the request")
+	}
+}
+
+// TestAgentForwardingRequestAfterHandledIsRejected checks that an
+// auth-agent-req arriving after a shell/exec/subsystem request has already
+// claimed the session is rejected rather than raced against: without a
+// sess.handled guard here, handleRequests would keep writing
+// sess.agentForwarded while the handler goroutine concurrently reads it
+// through AgentForwarded(), a data race go test -race catches.
+func TestAgentForwardingRequestAfterHandledIsRejected(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	sess := &session{
+		Channel:           &fakeChannel{},
+		agentForwardingCb: func(ctx Context) bool { return true },
+		handler: func(s Session) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				s.AgentForwarded()
+			}
+		},
+	}
+
+	reqs := make(chan *gossh.Request, 2)
+	reqs <- &gossh.Request{Type: "shell", Payload: gossh.Marshal(&struct{ Value string }{})}
+	reqs <- &gossh.Request{Type: agentRequestType}
+	close(reqs)
+	sess.handleRequests(reqs)
+	wg.Wait()
+
+	if sess.AgentForwarded() {
+		t.Fatal("auth-agent-req arriving after the session is handled should be rejected")
+	}
+}
+
+// TestAgentListenerClosedOnSessionExit checks that closeAgentListener tears
+// down the listener a handler registered via SetAgentListener, so a
+// handler that forgets to close its own agent-forwarding listener doesn't
+// leak the socket.
+func TestAgentListenerClosedOnSessionExit(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	sess := &session{}
+	sess.SetAgentListener(l)
+
+	closeAgentListener(sess)
+
+	if err := l.Close(); err == nil {
+		t.Fatal("expected the listener to already be closed")
+	}
+}
+
+// TestCloseAgentListenerNoop checks that closeAgentListener is a safe
+// no-op when no listener was ever registered.
+func TestCloseAgentListenerNoop(t *testing.T) {
+	sess := &session{}
+	closeAgentListener(sess)
+}
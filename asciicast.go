@@ -0,0 +1,128 @@
+package ssh
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// asciicastHeader is the first line of an asciicast v2 recording. See
+// https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md.
+// User and RemoteAddr aren't part of that spec; they're additional fields
+// an asciinema-compatible player will simply ignore, carried along so a
+// recording is still identifiable as an audit record on its own.
+type asciicastHeader struct {
+	Version    int               `json:"version"`
+	Width      int               `json:"width"`
+	Height     int               `json:"height"`
+	Timestamp  int64             `json:"timestamp"`
+	Env        map[string]string `json:"env,omitempty"`
+	Command    string            `json:"command,omitempty"`
+	User       string            `json:"user,omitempty"`
+	RemoteAddr string            `json:"remoteAddr,omitempty"`
+}
+
+// AsciicastRecorder is a built-in SessionRecorder that writes a session in
+// the asciicast v2 format, a de-facto terminal-replay format supported by
+// asciinema and compatible players, so recordings need no extra dependency
+// to produce or play back. v2 only defines "o" (output) and "i" (input)
+// event codes; it has no mid-stream resize event, so a pty resize isn't
+// recorded as an event (see WritePtyResize). Players still get the
+// session's starting dimensions from the header.
+type AsciicastRecorder struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	start time.Time
+	errCb func(error)
+}
+
+// NewAsciicastRecorder writes an asciicast v2 header describing sess to w
+// and returns a recorder that appends "o"/"i" event lines as the session
+// progresses. now is used both as the header timestamp and as the
+// zero point event delays are measured from. errCb, if non-nil, is called
+// whenever a write to w fails; writes are otherwise dropped silently, since
+// SessionRecorder methods must never fail the session.
+//
+// envAllowlist names the environment variables, if any, that may appear in
+// the header's env field; sess.Environ() is filtered down to just those
+// keys before it's written. A recording is a durable audit artifact, so
+// nothing is allowlisted by default: a nil or empty envAllowlist omits env
+// entirely rather than risk writing a credential or token into it.
+func NewAsciicastRecorder(w io.Writer, sess Session, win Window, now time.Time, envAllowlist []string, errCb func(error)) *AsciicastRecorder {
+	r := &AsciicastRecorder{
+		enc:   json.NewEncoder(w),
+		start: now,
+		errCb: errCb,
+	}
+	r.write(asciicastHeader{
+		Version:    2,
+		Width:      win.Width,
+		Height:     win.Height,
+		Timestamp:  now.Unix(),
+		Env:        filterEnv(sess.Environ(), envAllowlist),
+		Command:    strings.Join(sess.Command(), " "),
+		User:       sess.User(),
+		RemoteAddr: sess.RemoteAddr().String(),
+	})
+	return r
+}
+
+// WriteInput implements SessionRecorder.
+func (r *AsciicastRecorder) WriteInput(p []byte) {
+	r.writeEvent("i", p)
+}
+
+// WriteOutput implements SessionRecorder.
+func (r *AsciicastRecorder) WriteOutput(p []byte) {
+	r.writeEvent("o", p)
+}
+
+// WritePtyResize implements SessionRecorder. The asciicast v2 format this
+// recorder writes has no event for a mid-session resize (only "o"/"i" are
+// defined), so this is a no-op; recording one as a made-up "r" event would
+// break real v2 players that don't expect it.
+func (r *AsciicastRecorder) WritePtyResize(win Window) {}
+
+// Close implements SessionRecorder. The asciicast format needs no footer,
+// so Close is a no-op.
+func (r *AsciicastRecorder) Close() error {
+	return nil
+}
+
+func (r *AsciicastRecorder) writeEvent(kind string, p []byte) {
+	r.write([3]interface{}{time.Since(r.start).Seconds(), kind, string(p)})
+}
+
+func (r *AsciicastRecorder) write(v interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(v); err != nil && r.errCb != nil {
+		r.errCb(err)
+	}
+}
+
+// filterEnv parses env's "KEY=VALUE" entries into a map, keeping only the
+// keys named in allowlist. A nil or empty allowlist keeps nothing.
+func filterEnv(env []string, allowlist []string) map[string]string {
+	if len(env) == 0 || len(allowlist) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool, len(allowlist))
+	for _, k := range allowlist {
+		allowed[k] = true
+	}
+	var m map[string]string
+	for _, kv := range env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || !allowed[parts[0]] {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]string, len(allowlist))
+		}
+		m[parts[0]] = parts[1]
+	}
+	return m
+}
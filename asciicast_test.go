@@ -0,0 +1,112 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeRecorderSession implements just enough of Session for
+// NewAsciicastRecorder's header to read from; every other method panics if
+// called, since the tests here never reach them.
+type fakeRecorderSession struct {
+	Session
+	user       string
+	remoteAddr net.Addr
+	env        []string
+	cmd        []string
+}
+
+func (s *fakeRecorderSession) User() string         { return s.user }
+func (s *fakeRecorderSession) RemoteAddr() net.Addr { return s.remoteAddr }
+func (s *fakeRecorderSession) Environ() []string    { return s.env }
+func (s *fakeRecorderSession) Command() []string    { return s.cmd }
+
+// TestNewAsciicastRecorderHeader checks that the header line identifies
+// the session it came from: user, remote address, command and pty
+// dimensions, alongside the environment asciicast v2 already expects.
+func TestNewAsciicastRecorderHeader(t *testing.T) {
+	sess := &fakeRecorderSession{
+		user:       "alice",
+		remoteAddr: &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 52214},
+		env:        []string{"TERM=xterm"},
+		cmd:        []string{"bash", "-l"},
+	}
+
+	var buf bytes.Buffer
+	NewAsciicastRecorder(&buf, sess, Window{Width: 80, Height: 24}, time.Unix(1700000000, 0), []string{"TERM"}, nil)
+
+	var got asciicastHeader
+	if err := json.Unmarshal(bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0], &got); err != nil {
+		t.Fatalf("failed to unmarshal header: %v", err)
+	}
+
+	if got.User != "alice" {
+		t.Fatalf("User = %q, want %q", got.User, "alice")
+	}
+	if got.RemoteAddr != "203.0.113.5:52214" {
+		t.Fatalf("RemoteAddr = %q, want %q", got.RemoteAddr, "203.0.113.5:52214")
+	}
+	if got.Command != "bash -l" {
+		t.Fatalf("Command = %q, want %q", got.Command, "bash -l")
+	}
+	if got.Width != 80 || got.Height != 24 {
+		t.Fatalf("dimensions = %dx%d, want 80x24", got.Width, got.Height)
+	}
+	if len(got.Env) != 1 || got.Env["TERM"] != "xterm" {
+		t.Fatalf("Env = %v, want map with only TERM=xterm", got.Env)
+	}
+}
+
+// TestNewAsciicastRecorderEnvAllowlist checks that env entries outside the
+// allowlist never reach the header, and that a nil allowlist omits env
+// entirely rather than defaulting to recording everything.
+func TestNewAsciicastRecorderEnvAllowlist(t *testing.T) {
+	sess := &fakeRecorderSession{
+		remoteAddr: &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 52214},
+		env:        []string{"TERM=xterm", "AWS_SECRET_ACCESS_KEY=super-secret", "LANG=C"},
+	}
+
+	var buf bytes.Buffer
+	NewAsciicastRecorder(&buf, sess, Window{}, time.Unix(1700000000, 0), []string{"TERM", "LANG"}, nil)
+
+	var got asciicastHeader
+	if err := json.Unmarshal(bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0], &got); err != nil {
+		t.Fatalf("failed to unmarshal header: %v", err)
+	}
+	if len(got.Env) != 2 || got.Env["TERM"] != "xterm" || got.Env["LANG"] != "C" {
+		t.Fatalf("Env = %v, want map with only TERM and LANG", got.Env)
+	}
+	if _, ok := got.Env["AWS_SECRET_ACCESS_KEY"]; ok {
+		t.Fatal("AWS_SECRET_ACCESS_KEY leaked into the recording despite not being allowlisted")
+	}
+
+	buf.Reset()
+	got = asciicastHeader{}
+	NewAsciicastRecorder(&buf, sess, Window{}, time.Unix(1700000000, 0), nil, nil)
+	if err := json.Unmarshal(bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0], &got); err != nil {
+		t.Fatalf("failed to unmarshal header: %v", err)
+	}
+	if len(got.Env) != 0 {
+		t.Fatalf("Env = %v, want empty with a nil allowlist", got.Env)
+	}
+}
+
+// TestAsciicastRecorderWritePtyResizeIsNoop checks that a resize doesn't
+// add an event line: asciicast v2 has no event code for it, and emitting
+// one anyway would break real v2 players.
+func TestAsciicastRecorderWritePtyResizeIsNoop(t *testing.T) {
+	sess := &fakeRecorderSession{remoteAddr: &net.TCPAddr{}}
+
+	var buf bytes.Buffer
+	r := NewAsciicastRecorder(&buf, sess, Window{Width: 80, Height: 24}, time.Unix(1700000000, 0), nil, nil)
+	before := buf.Len()
+
+	r.WritePtyResize(Window{Width: 100, Height: 40})
+
+	if buf.Len() != before {
+		t.Fatalf("WritePtyResize wrote %d bytes, want 0 (no v2 event for resize)", buf.Len()-before)
+	}
+}
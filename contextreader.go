@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// ContextReader wraps an io.Reader so a read can be abandoned when a
+// context.Context is cancelled without losing bytes the underlying reader
+// already produced. It mirrors the contextReader Tailscale's tailssh
+// package uses to let a session handler time out, or stop reading when a
+// client disconnects, without having to close the channel to unblock a
+// pending Read.
+//
+// At most one background read is ever in flight: if ReadContext is
+// cancelled while a read is outstanding, the read keeps running and its
+// result (data and/or error) is buffered for the next call instead of
+// being discarded.
+type ContextReader struct {
+	mu          sync.Mutex
+	r           io.Reader
+	outstanding bool
+	resultCh    chan contextReadResult
+	leftover    []byte
+	leftoverErr error
+}
+
+type contextReadResult struct {
+	b   []byte
+	err error
+}
+
+// NewContextReader returns a ContextReader that reads from r.
+func NewContextReader(r io.Reader) *ContextReader {
+	return &ContextReader{r: r}
+}
+
+// ReadContext reads from the underlying reader into p. It returns early with
+// ctx.Err() if ctx is done before data becomes available; in that case the
+// background read is left running and its eventual result is delivered to
+// the next ReadContext call instead of being lost.
+func (cr *ContextReader) ReadContext(ctx context.Context, p []byte) (int, error) {
+	cr.mu.Lock()
+	if len(cr.leftover) > 0 {
+		n := copy(p, cr.leftover)
+		cr.leftover = cr.leftover[n:]
+		cr.mu.Unlock()
+		return n, nil
+	}
+	if cr.leftoverErr != nil {
+		err := cr.leftoverErr
+		cr.leftoverErr = nil
+		cr.mu.Unlock()
+		return 0, err
+	}
+	if !cr.outstanding {
+		cr.outstanding = true
+		cr.resultCh = make(chan contextReadResult, 1)
+		go func(ch chan contextReadResult, size int) {
+			buf := make([]byte, size)
+			n, err := cr.r.Read(buf)
+			ch <- contextReadResult{buf[:n], err}
+		}(cr.resultCh, len(p))
+	}
+	resultCh := cr.resultCh
+	cr.mu.Unlock()
+
+	select {
+	case res := <-resultCh:
+		cr.mu.Lock()
+		cr.outstanding = false
+		cr.mu.Unlock()
+		n := copy(p, res.b)
+		if n < len(res.b) {
+			cr.mu.Lock()
+			cr.leftover = res.b[n:]
+			cr.leftoverErr = res.err
+			cr.mu.Unlock()
+			return n, nil
+		}
+		return n, res.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
@@ -0,0 +1,121 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// controlledReader lets a test dictate exactly when and what a Read call
+// returns, so cancellation races can be tested deterministically instead of
+// relying on real I/O timing.
+type controlledReader struct {
+	ch chan controlledReadResult
+}
+
+type controlledReadResult struct {
+	b   []byte
+	err error
+}
+
+func newControlledReader() *controlledReader {
+	return &controlledReader{ch: make(chan controlledReadResult)}
+}
+
+func (r *controlledReader) Read(p []byte) (int, error) {
+	res := <-r.ch
+	n := copy(p, res.b)
+	return n, res.err
+}
+
+func TestContextReaderPassthrough(t *testing.T) {
+	r := newControlledReader()
+	cr := NewContextReader(r)
+
+	go func() { r.ch <- controlledReadResult{b: []byte("hello")} }()
+
+	buf := make([]byte, 16)
+	n, err := cr.ReadContext(context.Background(), buf)
+	if err != nil {
+		t.Fatalf("ReadContext returned error: %v", err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Fatalf("got %q, want %q", buf[:n], "hello")
+	}
+}
+
+func TestContextReaderCancelBeforeData(t *testing.T) {
+	r := newControlledReader()
+	cr := NewContextReader(r)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	buf := make([]byte, 16)
+	n, err := cr.ReadContext(ctx, buf)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got err %v, want context.Canceled", err)
+	}
+	if n != 0 {
+		t.Fatalf("got n=%d, want 0", n)
+	}
+}
+
+func TestContextReaderCancelAfterDataBuffered(t *testing.T) {
+	r := newControlledReader()
+	cr := NewContextReader(r)
+
+	// Start a read with a buffer big enough to hold the eventual result and
+	// cancel before the controlled reader produces anything; the
+	// background goroutine, sized from this call's buffer, stays
+	// outstanding.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bigBuf := make([]byte, 16)
+	if _, err := cr.ReadContext(ctx, bigBuf); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got err %v, want context.Canceled", err)
+	}
+
+	// The outstanding read now completes with more data than the next
+	// caller's (smaller) buffer can hold, so it must be split across calls.
+	r.ch <- controlledReadResult{b: []byte("abcdef"), err: errEOFMarker}
+
+	buf := make([]byte, 4)
+	n, err := cr.ReadContext(context.Background(), buf)
+	if err != nil {
+		t.Fatalf("unexpected error on first drain: %v", err)
+	}
+	if string(buf[:n]) != "abcd" {
+		t.Fatalf("got %q, want %q", buf[:n], "abcd")
+	}
+
+	buf2 := make([]byte, 4)
+	n, err = cr.ReadContext(context.Background(), buf2)
+	if err != nil {
+		t.Fatalf("unexpected error while leftover bytes remain: %v", err)
+	}
+	if string(buf2[:n]) != "ef" {
+		t.Fatalf("got %q, want %q", buf2[:n], "ef")
+	}
+
+	// Once the leftover bytes are drained, the buffered error surfaces.
+	if _, err := cr.ReadContext(context.Background(), buf2); !errors.Is(err, errEOFMarker) {
+		t.Fatalf("got err %v, want errEOFMarker", err)
+	}
+}
+
+var errEOFMarker = errors.New("controlled reader eof marker")
+
+func TestContextReaderTimeout(t *testing.T) {
+	r := newControlledReader()
+	cr := NewContextReader(r)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	buf := make([]byte, 4)
+	if _, err := cr.ReadContext(ctx, buf); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got err %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,53 @@
+package ssh
+
+import gossh "golang.org/x/crypto/ssh"
+
+// SessionRecorder receives a copy of everything read from and written to a
+// Session, along with pty resize events, so that a session can be replayed
+// later. WriteInput, WriteOutput and WritePtyResize must not block for long
+// since they run inline with the session's read/write and request-handling
+// paths; an implementation that needs to report a failure (e.g. a disk
+// write error) should do so through its own error channel rather than by
+// returning one, since none of these calls can fail the session.
+type SessionRecorder interface {
+	// WriteInput is called with bytes read from the client, i.e. keystrokes
+	// or piped stdin.
+	WriteInput(p []byte)
+
+	// WriteOutput is called with bytes written to the client, i.e. command
+	// output.
+	WriteOutput(p []byte)
+
+	// WritePtyResize is called whenever the client's pty is resized.
+	WritePtyResize(win Window)
+
+	// Close flushes and releases any resources held by the recorder. It is
+	// called once the session's request stream ends. When the handler
+	// returns first, that is after the handler's Exit has closed the
+	// channel; when the client closes the channel first, Close can run
+	// while the handler is still reading and writing.
+	Close() error
+}
+
+// recordingChannel wraps a gossh.Channel so that reads and writes are teed to
+// a SessionRecorder.
+type recordingChannel struct {
+	gossh.Channel
+	rec SessionRecorder
+}
+
+func (c *recordingChannel) Read(p []byte) (int, error) {
+	n, err := c.Channel.Read(p)
+	if n > 0 {
+		c.rec.WriteInput(p[:n])
+	}
+	return n, err
+}
+
+func (c *recordingChannel) Write(p []byte) (int, error) {
+	n, err := c.Channel.Write(p)
+	if n > 0 {
+		c.rec.WriteOutput(p[:n])
+	}
+	return n, err
+}
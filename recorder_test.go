@@ -0,0 +1,180 @@
+package ssh
+
+import (
+	"io"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// fakeChannel is a minimal gossh.Channel backed by in-memory buffers, just
+// enough to exercise recordingChannel without a real SSH connection.
+type fakeChannel struct {
+	toRead  []byte
+	written []byte
+}
+
+func (c *fakeChannel) Read(p []byte) (int, error) {
+	if len(c.toRead) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.toRead)
+	c.toRead = c.toRead[n:]
+	return n, nil
+}
+
+func (c *fakeChannel) Write(p []byte) (int, error) {
+	c.written = append(c.written, p...)
+	return len(p), nil
+}
+
+func (c *fakeChannel) Close() error      { return nil }
+func (c *fakeChannel) CloseWrite() error { return nil }
+func (c *fakeChannel) Stderr() io.ReadWriter {
+	return nil
+}
+func (c *fakeChannel) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	return true, nil
+}
+
+// fakeRecorder captures everything it's sent so tests can assert on it.
+type fakeRecorder struct {
+	input    []byte
+	output   []byte
+	resize   []Window
+	closed   bool
+	closeErr error
+}
+
+func (r *fakeRecorder) WriteInput(p []byte)       { r.input = append(r.input, p...) }
+func (r *fakeRecorder) WriteOutput(p []byte)      { r.output = append(r.output, p...) }
+func (r *fakeRecorder) WritePtyResize(win Window) { r.resize = append(r.resize, win) }
+func (r *fakeRecorder) Close() error              { r.closed = true; return r.closeErr }
+
+func TestRecordingChannelTeesReadWrite(t *testing.T) {
+	fc := &fakeChannel{toRead: []byte("input")}
+	rec := &fakeRecorder{}
+	rc := &recordingChannel{Channel: fc, rec: rec}
+
+	buf := make([]byte, 16)
+	n, err := rc.Read(buf)
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if string(rec.input) != "input" {
+		t.Fatalf("recorder got input %q, want %q", rec.input, "input")
+	}
+	if string(buf[:n]) != "input" {
+		t.Fatalf("Read returned %q, want %q", buf[:n], "input")
+	}
+
+	if _, err := rc.Write([]byte("output")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	if string(rec.output) != "output" {
+		t.Fatalf("recorder got output %q, want %q", rec.output, "output")
+	}
+	if string(fc.written) != "output" {
+		t.Fatalf("underlying channel got %q, want %q", fc.written, "output")
+	}
+}
+
+// TestSessionRecorderSeesNegotiatedState is the regression test for the
+// header-timing bug: the factory must not run until cmd/env/pty are known,
+// since the built-in AsciicastRecorder (and any other implementation) reads
+// them through the Session it's given to build its header.
+func TestSessionRecorderSeesNegotiatedState(t *testing.T) {
+	var gotCmd []string
+	var gotEnv []string
+	var gotPty Pty
+	var gotOK bool
+	rec := &fakeRecorder{}
+
+	sess := &session{
+		Channel: &fakeChannel{},
+		handler: func(s Session) {},
+		pty:     &Pty{Term: "xterm", Window: Window{Width: 80, Height: 24}},
+		recorderFactory: func(s Session) (SessionRecorder, error) {
+			gotCmd = s.Command()
+			gotEnv = s.Environ()
+			gotPty, _, gotOK = s.Pty()
+			return rec, nil
+		},
+	}
+
+	reqs := make(chan *gossh.Request, 2)
+	reqs <- &gossh.Request{Type: "env", Payload: gossh.Marshal(&struct{ Key, Value string }{"FOO", "bar"})}
+	reqs <- &gossh.Request{Type: "shell", Payload: gossh.Marshal(&struct{ Value string }{""})}
+	close(reqs)
+	sess.handleRequests(reqs)
+
+	if len(gotCmd) != 0 {
+		t.Fatalf("Command() = %v, want empty (shell request)", gotCmd)
+	}
+	if len(gotEnv) != 1 || gotEnv[0] != "FOO=bar" {
+		t.Fatalf("Environ() = %v, want [FOO=bar]", gotEnv)
+	}
+	if !gotOK || gotPty.Window != (Window{Width: 80, Height: 24}) {
+		t.Fatalf("Pty() = %+v, ok=%v, want 80x24 pty", gotPty, gotOK)
+	}
+	if !rec.closed {
+		t.Fatal("expected the recorder to be closed once handleRequests returns")
+	}
+}
+
+// TestWindowChangeForwardedToRecorder checks that an in-progress pty resize
+// is mirrored to a recorder already attached to the session.
+func TestWindowChangeForwardedToRecorder(t *testing.T) {
+	rec := &fakeRecorder{}
+	sess := &session{
+		recorder: rec,
+		pty:      &Pty{Term: "xterm", Window: Window{Width: 80, Height: 24}},
+		winch:    make(chan Window, 1),
+	}
+
+	win := Window{Width: 100, Height: 40}
+	payload := struct{ Width, Height, PixelWidth, PixelHeight uint32 }{
+		uint32(win.Width), uint32(win.Height), 0, 0,
+	}
+	reqs := make(chan *gossh.Request, 1)
+	reqs <- &gossh.Request{Type: "window-change", Payload: gossh.Marshal(&payload)}
+	close(reqs)
+	sess.handleRequests(reqs)
+
+	if len(rec.resize) != 1 || rec.resize[0] != win {
+		t.Fatalf("recorder got resize events %v, want one %+v event", rec.resize, win)
+	}
+}
+
+// TestRecorderCloseErrorRoutedToErrCb checks that an error from
+// SessionRecorder.Close reaches recorderErrCb just like a factory error
+// does, instead of being dropped on the floor.
+func TestRecorderCloseErrorRoutedToErrCb(t *testing.T) {
+	closeErr := io.ErrClosedPipe
+	rec := &fakeRecorder{closeErr: closeErr}
+
+	var gotSess Session
+	var gotErr error
+	sess := &session{
+		Channel:  &fakeChannel{},
+		recorder: rec,
+		recorderErrCb: func(s Session, err error) {
+			gotSess = s
+			gotErr = err
+		},
+	}
+
+	reqs := make(chan *gossh.Request)
+	close(reqs)
+	sess.handleRequests(reqs)
+
+	if !rec.closed {
+		t.Fatal("expected the recorder to be closed")
+	}
+	if gotErr != closeErr {
+		t.Fatalf("recorderErrCb got err %v, want %v", gotErr, closeErr)
+	}
+	if gotSess != sess {
+		t.Fatalf("recorderErrCb got session %v, want %v", gotSess, sess)
+	}
+}
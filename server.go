@@ -0,0 +1,54 @@
+package ssh
+
+// Server defines the per-connection callbacks and handlers this package's
+// session, subsystem, agent-forwarding, X11 and recording support hang off
+// of. The zero value rejects every session feature that requires an
+// explicit opt-in (subsystems, agent forwarding, X11, recording) and
+// otherwise behaves like a plain exec/shell server.
+type Server struct {
+	// Handler handles shell and exec sessions.
+	Handler Handler
+
+	// PtyCallback, if non-nil, is consulted before a pty-req is accepted.
+	PtyCallback PtyCallback
+
+	// SubsystemHandlers maps a subsystem name (e.g. "sftp") to the handler
+	// that serves it. Populate it with Handle or HandleSubsystem rather
+	// than assigning the map directly.
+	SubsystemHandlers map[string]SubsystemHandler
+
+	// AgentForwardingCallback, if non-nil, is consulted before an
+	// auth-agent-req@openssh.com request is accepted. A nil callback
+	// denies all agent forwarding requests.
+	AgentForwardingCallback func(ctx Context) bool
+
+	// X11Callback, if non-nil, is consulted before an x11-req is accepted.
+	// A nil callback denies all X11 forwarding requests.
+	X11Callback func(ctx Context, x11 X11) bool
+
+	// X11ChannelHandler handles an "x11" channel a client opens back to
+	// the server once an earlier x11-req was accepted. When nil, the
+	// server's channel dispatch rejects "x11" channels with
+	// RejectX11Channel instead.
+	X11ChannelHandler X11ChannelHandler
+
+	// SessionRecorderFactory, if non-nil, is called once per session,
+	// after cmd/env/pty negotiation has settled, to build a
+	// SessionRecorder that tees the session's input, output and pty
+	// resizes.
+	SessionRecorderFactory func(Session) (SessionRecorder, error)
+
+	// RecorderErrorCallback, if non-nil, is called with any error a
+	// SessionRecorder returns. Recording errors never fail the session.
+	RecorderErrorCallback func(Session, error)
+}
+
+// x11ChannelHandler returns the handler srv's channel dispatch should
+// invoke for an incoming "x11" channel: srv.X11ChannelHandler if one is
+// configured, RejectX11Channel otherwise.
+func (srv *Server) x11ChannelHandler() X11ChannelHandler {
+	if srv.X11ChannelHandler != nil {
+		return srv.X11ChannelHandler
+	}
+	return RejectX11Channel
+}
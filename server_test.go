@@ -0,0 +1,62 @@
+package ssh
+
+import (
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// fakeNewChannel is a minimal gossh.NewChannel, just enough to observe
+// whether RejectX11Channel was invoked.
+type fakeNewChannel struct {
+	rejected       bool
+	rejectedReason gossh.RejectionReason
+}
+
+func (c *fakeNewChannel) Accept() (gossh.Channel, <-chan *gossh.Request, error) {
+	return nil, nil, nil
+}
+
+func (c *fakeNewChannel) Reject(reason gossh.RejectionReason, message string) error {
+	c.rejected = true
+	c.rejectedReason = reason
+	return nil
+}
+
+func (c *fakeNewChannel) ChannelType() string { return "x11" }
+func (c *fakeNewChannel) ExtraData() []byte   { return nil }
+
+// TestServerX11ChannelHandlerDefaultsToReject checks that an "x11" channel
+// is rejected when Server.X11ChannelHandler isn't configured.
+func TestServerX11ChannelHandlerDefaultsToReject(t *testing.T) {
+	srv := &Server{}
+	nc := &fakeNewChannel{}
+
+	srv.x11ChannelHandler()(srv, nil, nc, nil)
+
+	if !nc.rejected {
+		t.Fatal("expected the default X11 channel handler to reject the channel")
+	}
+}
+
+// TestServerX11ChannelHandlerRoutedWhenSet checks that a configured
+// Server.X11ChannelHandler, rather than RejectX11Channel, handles an "x11"
+// channel.
+func TestServerX11ChannelHandlerRoutedWhenSet(t *testing.T) {
+	called := false
+	srv := &Server{
+		X11ChannelHandler: func(srv *Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx Context) {
+			called = true
+		},
+	}
+	nc := &fakeNewChannel{}
+
+	srv.x11ChannelHandler()(srv, nil, nc, nil)
+
+	if !called {
+		t.Fatal("expected the configured X11ChannelHandler to run instead of RejectX11Channel")
+	}
+	if nc.rejected {
+		t.Fatal("the configured X11ChannelHandler should have been used, not RejectX11Channel")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 
 	"github.com/anmitsu/go-shlex"
 	gossh "golang.org/x/crypto/ssh"
@@ -17,8 +18,6 @@ import (
 //
 // When Command() returns an empty slice, the user requested a shell. Otherwise
 // the user is performing an exec with those command arguments.
-//
-// TODO: Signals
 type Session interface {
 	gossh.Channel
 
@@ -57,7 +56,43 @@ type Session interface {
 	// of whether or not a PTY was accepted for this session.
 	Pty() (Pty, <-chan Window, bool)
 
-	// TODO: Signals(c chan<- Signal)
+	// Signals registers a channel to receive signals sent from the client. The
+	// channel must handle signal sends non-blocking, otherwise future signals
+	// may be dropped.
+	Signals(c chan<- Signal)
+
+	// Break registers a channel to receive notifications of break requests sent
+	// from the client. The channel must handle break sends non-blocking,
+	// otherwise future break requests may be dropped.
+	Break(c chan<- bool)
+
+	// ExitSignal sends an exit-signal request and then closes the session,
+	// reporting that the remote command terminated violently with the given
+	// signal, as defined by RFC 4254 Section 6.10.
+	ExitSignal(sig Signal, coreDumped bool, msg, lang string) error
+
+	// Subsystem returns the name of the requested SSH subsystem, or the empty
+	// string if the session is a shell or exec.
+	Subsystem() string
+
+	// AgentForwarded returns whether the client successfully requested agent
+	// forwarding for this session.
+	AgentForwarded() bool
+
+	// SetAgentListener registers the net.Listener a handler created to
+	// accept forwarded agent connections, so it gets closed when the
+	// session exits even if the handler never closes it itself.
+	SetAgentListener(l net.Listener)
+
+	// X11 returns the negotiated X11 forwarding parameters and whether the
+	// client's x11-req was accepted.
+	X11() (X11, bool)
+
+	// ReadContext behaves like Read but returns ctx.Err() as soon as ctx is
+	// done, even if the underlying channel has no data yet. A read that was
+	// already in flight when ctx was cancelled is not abandoned; its result
+	// is delivered to the next ReadContext (or Read) call.
+	ReadContext(ctx context.Context, p []byte) (int, error)
 }
 
 func sessionHandler(srv *Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx *sshContext) {
@@ -67,27 +102,77 @@ func sessionHandler(srv *Server, conn *gossh.ServerConn, newChan gossh.NewChanne
 		return
 	}
 	sess := &session{
-		Channel: ch,
-		conn:    conn,
-		handler: srv.Handler,
-		ptyCb:   srv.PtyCallback,
-		ctx:     ctx,
+		Channel:           ch,
+		conn:              conn,
+		handler:           srv.Handler,
+		ptyCb:             srv.PtyCallback,
+		subsystemHandlers: srv.SubsystemHandlers,
+		agentForwardingCb: srv.AgentForwardingCallback,
+		x11Cb:             srv.X11Callback,
+		recorderFactory:   srv.SessionRecorderFactory,
+		recorderErrCb:     srv.RecorderErrorCallback,
+		ctx:               ctx,
 	}
+	defer func() {
+		if sess.agentForwarded {
+			closeAgentListener(sess)
+		}
+	}()
 	sess.handleRequests(reqs)
 }
 
+// startRecording begins session recording, if a SessionRecorderFactory is
+// configured, and (re)builds ctxReader on top of sess.Channel so Read and
+// ReadContext go through any recording wrapper applied here. It is called
+// once cmd/env/pty negotiation has settled, right before a shell, exec or
+// subsystem handler starts reading and writing the channel, so the
+// recorder's session-start header sees the real command, environment and
+// pty dimensions instead of the zero values they'd still have immediately
+// after channel accept.
+func (sess *session) startRecording() {
+	if sess.recorderFactory != nil {
+		rec, err := sess.recorderFactory(sess)
+		if err != nil {
+			if sess.recorderErrCb != nil {
+				sess.recorderErrCb(sess, err)
+			}
+		} else {
+			sess.recorder = rec
+			sess.Channel = &recordingChannel{Channel: sess.Channel, rec: rec}
+		}
+	}
+	sess.ctxReader = NewContextReader(sess.Channel)
+}
+
 type session struct {
 	gossh.Channel
-	conn    *gossh.ServerConn
-	handler Handler
-	handled bool
-	exited  bool
-	pty     *Pty
-	winch   chan Window
-	env     []string
-	ptyCb   PtyCallback
-	cmd     []string
-	ctx     *sshContext
+	conn              *gossh.ServerConn
+	handler           Handler
+	handled           bool
+	exited            bool
+	pty               *Pty
+	winch             chan Window
+	env               []string
+	ptyCb             PtyCallback
+	cmd               []string
+	subsystem         string
+	subsystemHandlers map[string]SubsystemHandler
+	recorder          SessionRecorder
+	recorderFactory   func(Session) (SessionRecorder, error)
+	recorderErrCb     func(Session, error)
+	agentForwardingCb func(ctx Context) bool
+	agentForwarded    bool
+	agentListenerMu   sync.Mutex
+	agentListener     net.Listener
+	x11Cb             func(ctx Context, x11 X11) bool
+	x11               X11
+	x11Accepted       bool
+	ctxReader         *ContextReader
+	ctx               *sshContext
+	sigLock           sync.Mutex
+	sigCh             chan<- Signal
+	sigBuf            []Signal
+	breakCh           chan<- bool
 }
 
 func (sess *session) Write(p []byte) (n int, err error) {
@@ -135,6 +220,57 @@ func (sess *session) Exit(code int) error {
 	return sess.Close()
 }
 
+// ExitSignal sends an exit-signal request and then closes the session. See
+// RFC 4254 Section 6.10 for the meaning of each field.
+func (sess *session) ExitSignal(sig Signal, coreDumped bool, msg, lang string) error {
+	if sess.exited {
+		return errors.New("Session.Exit called multiple times")
+	}
+	sess.exited = true
+
+	status := struct {
+		Signal     string
+		CoreDumped bool
+		Error      string
+		Lang       string
+	}{string(sig), coreDumped, msg, lang}
+	_, err := sess.SendRequest("exit-signal", false, gossh.Marshal(&status))
+	if err != nil {
+		return err
+	}
+	return sess.Close()
+}
+
+// Signals registers c to receive signals sent from the client. Signals are
+// delivered non-blocking: if c is unbuffered or full, the signal is dropped
+// rather than stalling the request loop.
+func (sess *session) Signals(c chan<- Signal) {
+	sess.sigLock.Lock()
+	defer sess.sigLock.Unlock()
+	sess.sigCh = c
+	if len(sess.sigBuf) > 0 {
+		buf := sess.sigBuf
+		sess.sigBuf = nil
+		go func() {
+			for _, sig := range buf {
+				select {
+				case c <- sig:
+				default:
+				}
+			}
+		}()
+	}
+}
+
+// Break registers c to receive notifications of break requests sent from the
+// client. Break requests are delivered non-blocking: if c is unbuffered or
+// full, the request is dropped rather than stalling the request loop.
+func (sess *session) Break(c chan<- bool) {
+	sess.sigLock.Lock()
+	defer sess.sigLock.Unlock()
+	sess.breakCh = c
+}
+
 func (sess *session) User() string {
 	return sess.conn.User()
 }
@@ -151,6 +287,30 @@ func (sess *session) Command() []string {
 	return append([]string(nil), sess.cmd...)
 }
 
+func (sess *session) Subsystem() string {
+	return sess.subsystem
+}
+
+func (sess *session) AgentForwarded() bool {
+	return sess.agentForwarded
+}
+
+func (sess *session) X11() (X11, bool) {
+	return sess.x11, sess.x11Accepted
+}
+
+func (sess *session) ReadContext(ctx context.Context, p []byte) (int, error) {
+	return sess.ctxReader.ReadContext(ctx, p)
+}
+
+// Read reads from the session channel through ctxReader, so bytes a prior
+// cancelled ReadContext call left buffered are not stranded: Read and
+// ReadContext share the same underlying ContextReader and may be mixed
+// freely.
+func (sess *session) Read(p []byte) (int, error) {
+	return sess.ctxReader.ReadContext(context.Background(), p)
+}
+
 func (sess *session) Pty() (Pty, <-chan Window, bool) {
 	if sess.pty != nil {
 		return *sess.pty, sess.winch, true
@@ -159,6 +319,13 @@ func (sess *session) Pty() (Pty, <-chan Window, bool) {
 }
 
 func (sess *session) handleRequests(reqs <-chan *gossh.Request) {
+	defer func() {
+		if sess.recorder != nil {
+			if err := sess.recorder.Close(); err != nil && sess.recorderErrCb != nil {
+				sess.recorderErrCb(sess, err)
+			}
+		}
+	}()
 	for req := range reqs {
 		switch req.Type {
 		case "shell", "exec":
@@ -172,10 +339,31 @@ func (sess *session) handleRequests(reqs <-chan *gossh.Request) {
 			var payload = struct{ Value string }{}
 			gossh.Unmarshal(req.Payload, &payload)
 			sess.cmd, _ = shlex.Split(payload.Value, true)
+			sess.startRecording()
 			go func() {
 				sess.handler(sess)
 				sess.Exit(0)
 			}()
+		case "subsystem":
+			if sess.handled {
+				req.Reply(false, nil)
+				continue
+			}
+			var payload = struct{ Name string }{}
+			gossh.Unmarshal(req.Payload, &payload)
+			handler, ok := sess.subsystemHandlers[payload.Name]
+			if !ok {
+				req.Reply(false, nil)
+				continue
+			}
+			sess.handled = true
+			sess.subsystem = payload.Name
+			req.Reply(true, nil)
+			sess.startRecording()
+			go func() {
+				handler(sess)
+				sess.Exit(0)
+			}()
 		case "env":
 			if sess.handled {
 				req.Reply(false, nil)
@@ -219,10 +407,63 @@ func (sess *session) handleRequests(reqs <-chan *gossh.Request) {
 			if ok {
 				sess.pty.Window = win
 				sess.winch <- win
+				if sess.recorder != nil {
+					sess.recorder.WritePtyResize(win)
+				}
 			}
 			req.Reply(ok, nil)
+		case "signal":
+			var sigReq struct{ Signal string }
+			gossh.Unmarshal(req.Payload, &sigReq)
+			sess.sigLock.Lock()
+			if sess.sigCh != nil {
+				select {
+				case sess.sigCh <- Signal(sigReq.Signal):
+				default:
+				}
+			} else if len(sess.sigBuf) < maxSigBufSize {
+				sess.sigBuf = append(sess.sigBuf, Signal(sigReq.Signal))
+			}
+			sess.sigLock.Unlock()
+		case "break":
+			ok := false
+			sess.sigLock.Lock()
+			if sess.breakCh != nil {
+				ok = true
+				select {
+				case sess.breakCh <- true:
+				default:
+				}
+			}
+			sess.sigLock.Unlock()
+			req.Reply(ok, nil)
+		case "x11-req":
+			if sess.handled {
+				req.Reply(false, nil)
+				continue
+			}
+			x11req, ok := parseX11Request(req.Payload)
+			if !ok {
+				req.Reply(false, nil)
+				continue
+			}
+			if sess.x11Cb == nil || !sess.x11Cb(sess.ctx, x11req) {
+				req.Reply(false, nil)
+				continue
+			}
+			sess.x11 = x11req
+			sess.x11Accepted = true
+			req.Reply(true, nil)
 		case agentRequestType:
-			// TODO: option/callback to allow agent forwarding
+			if sess.handled {
+				req.Reply(false, nil)
+				continue
+			}
+			if sess.agentForwardingCb == nil || !sess.agentForwardingCb(sess.ctx) {
+				req.Reply(false, nil)
+				continue
+			}
+			sess.agentForwarded = true
 			setAgentRequested(sess)
 			req.Reply(true, nil)
 		default:
@@ -0,0 +1,28 @@
+package ssh
+
+// Signal represents a POSIX signal that can be delivered to a Session,
+// mirroring the subset of signal names defined by RFC 4254 Section 6.10.
+type Signal string
+
+// POSIX signals as listed in RFC 4254 Section 6.10. These are the values
+// gossh.Signal uses in the "signal" channel request payload.
+const (
+	SIGABRT Signal = "ABRT"
+	SIGALRM Signal = "ALRM"
+	SIGFPE  Signal = "FPE"
+	SIGHUP  Signal = "HUP"
+	SIGILL  Signal = "ILL"
+	SIGINT  Signal = "INT"
+	SIGKILL Signal = "KILL"
+	SIGPIPE Signal = "PIPE"
+	SIGQUIT Signal = "QUIT"
+	SIGSEGV Signal = "SEGV"
+	SIGTERM Signal = "TERM"
+	SIGUSR1 Signal = "USR1"
+	SIGUSR2 Signal = "USR2"
+)
+
+// maxSigBufSize caps the number of signals buffered before a handler
+// registers a listener with Signals, so a noisy client can't grow this
+// slice without bound.
+const maxSigBufSize = 128
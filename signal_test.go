@@ -0,0 +1,162 @@
+package ssh
+
+import (
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// newTestSignalRequest builds a "signal" channel request carrying sig, the
+// same shape handleRequests expects off the wire. WantReply is false, as
+// real clients send it for "signal", so req.Reply is a safe no-op in tests
+// that don't wire up a full gossh.Request.
+func newTestSignalRequest(sig Signal) *gossh.Request {
+	payload := struct{ Signal string }{string(sig)}
+	return &gossh.Request{Type: "signal", Payload: gossh.Marshal(&payload)}
+}
+
+func newTestBreakRequest() *gossh.Request {
+	return &gossh.Request{Type: "break", WantReply: false}
+}
+
+// TestSignalsLiveDelivery drives a "signal" request through handleRequests
+// after a consumer has already registered with Signals, and expects it
+// delivered immediately.
+func TestSignalsLiveDelivery(t *testing.T) {
+	sess := &session{}
+	c := make(chan Signal, 1)
+	sess.Signals(c)
+
+	reqs := make(chan *gossh.Request, 1)
+	reqs <- newTestSignalRequest(SIGINT)
+	close(reqs)
+	sess.handleRequests(reqs)
+
+	select {
+	case sig := <-c:
+		if sig != SIGINT {
+			t.Fatalf("got signal %q, want %q", sig, SIGINT)
+		}
+	default:
+		t.Fatal("expected a signal to be delivered")
+	}
+}
+
+// TestSignalsBufferedBeforeRegistration drives a "signal" request through
+// handleRequests before any consumer has registered, then registers one and
+// expects the buffered signal to be flushed to it.
+func TestSignalsBufferedBeforeRegistration(t *testing.T) {
+	sess := &session{}
+
+	reqs := make(chan *gossh.Request, 1)
+	reqs <- newTestSignalRequest(SIGHUP)
+	close(reqs)
+	sess.handleRequests(reqs)
+
+	c := make(chan Signal, 1)
+	sess.Signals(c)
+
+	select {
+	case sig := <-c:
+		if sig != SIGHUP {
+			t.Fatalf("got signal %q, want %q", sig, SIGHUP)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for buffered signal to flush")
+	}
+}
+
+// TestSignalsFlushNeverBlocks reproduces the scenario a non-blocking
+// delivery contract requires: Signals is handed a channel nobody ever
+// drains. The flush goroutine must not block the caller or leak forever
+// blocked on an unbuffered send.
+func TestSignalsFlushNeverBlocks(t *testing.T) {
+	sess := &session{}
+
+	reqs := make(chan *gossh.Request, 2)
+	reqs <- newTestSignalRequest(SIGUSR1)
+	reqs <- newTestSignalRequest(SIGUSR2)
+	close(reqs)
+	sess.handleRequests(reqs)
+
+	done := make(chan struct{})
+	go func() {
+		sess.Signals(make(chan Signal)) // unbuffered, never read from
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Signals blocked delivering to an unread channel")
+	}
+}
+
+func TestBreakDelivery(t *testing.T) {
+	sess := &session{}
+	c := make(chan bool, 1)
+	sess.Break(c)
+
+	reqs := make(chan *gossh.Request, 1)
+	reqs <- newTestBreakRequest()
+	close(reqs)
+	sess.handleRequests(reqs)
+
+	select {
+	case <-c:
+	default:
+		t.Fatal("expected a break notification to be delivered")
+	}
+}
+
+// requestCapturingChannel wraps fakeChannel to record the last SendRequest
+// call made against it, so ExitSignal's wire format can be asserted on.
+type requestCapturingChannel struct {
+	fakeChannel
+	name    string
+	payload []byte
+}
+
+func (c *requestCapturingChannel) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	c.name = name
+	c.payload = payload
+	return true, nil
+}
+
+// TestExitSignal drives ExitSignal through a fake channel and checks that
+// it sends a well-formed "exit-signal" request, per RFC 4254 Section 6.10,
+// then closes the session.
+func TestExitSignal(t *testing.T) {
+	ch := &requestCapturingChannel{}
+	sess := &session{Channel: ch}
+
+	if err := sess.ExitSignal(SIGSEGV, true, "segmentation fault", "en"); err != nil {
+		t.Fatalf("ExitSignal returned error: %v", err)
+	}
+
+	if ch.name != "exit-signal" {
+		t.Fatalf("sent request %q, want %q", ch.name, "exit-signal")
+	}
+
+	var got struct {
+		Signal     string
+		CoreDumped bool
+		Error      string
+		Lang       string
+	}
+	gossh.Unmarshal(ch.payload, &got)
+	want := struct {
+		Signal     string
+		CoreDumped bool
+		Error      string
+		Lang       string
+	}{string(SIGSEGV), true, "segmentation fault", "en"}
+	if got != want {
+		t.Fatalf("exit-signal payload = %+v, want %+v", got, want)
+	}
+
+	if err := sess.ExitSignal(SIGTERM, false, "", ""); err == nil {
+		t.Fatal("expected a second ExitSignal call on an already-exited session to error")
+	}
+}
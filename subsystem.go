@@ -0,0 +1,22 @@
+package ssh
+
+// SubsystemHandler is a callback for handling a subsystem request, such as
+// "sftp" or "netconf". The session passed in behaves the same as the one
+// passed to a Handler, except Command() will be empty and Subsystem() will
+// return the requested subsystem name.
+type SubsystemHandler func(s Session)
+
+// Handle registers a SubsystemHandler under the given subsystem name,
+// overwriting any handler previously registered for that name.
+func (srv *Server) Handle(name string, h SubsystemHandler) {
+	if srv.SubsystemHandlers == nil {
+		srv.SubsystemHandlers = map[string]SubsystemHandler{}
+	}
+	srv.SubsystemHandlers[name] = h
+}
+
+// HandleSubsystem is an alias for Handle, kept for readability at call sites
+// that register several subsystems alongside other Server setup.
+func (srv *Server) HandleSubsystem(name string, h SubsystemHandler) {
+	srv.Handle(name, h)
+}
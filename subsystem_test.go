@@ -0,0 +1,177 @@
+package ssh
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// pipeChannel adapts a pair of pipe ends to gossh.Channel, just enough to
+// let a SubsystemHandler read and write through a Session without a real
+// SSH transport underneath.
+type pipeChannel struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func (c *pipeChannel) Read(p []byte) (int, error)  { return c.r.Read(p) }
+func (c *pipeChannel) Write(p []byte) (int, error) { return c.w.Write(p) }
+func (c *pipeChannel) Close() error {
+	c.r.Close()
+	return c.w.Close()
+}
+func (c *pipeChannel) CloseWrite() error     { return c.w.Close() }
+func (c *pipeChannel) Stderr() io.ReadWriter { return nil }
+func (c *pipeChannel) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	return true, nil
+}
+
+// TestSubsystemSFTPRoundTrip registers an "sftp" subsystem backed by
+// github.com/pkg/sftp's server, drives it through handleRequests exactly
+// as a client's "subsystem" request would, and talks to it with a real
+// sftp.Client over an in-memory pipe pair (sftp's wire protocol doesn't
+// care that there's no SSH transport underneath, only that it's handed a
+// Session to read and write through).
+func TestSubsystemSFTPRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+
+	sess := &session{
+		Channel: &pipeChannel{r: serverRead, w: serverWrite},
+		subsystemHandlers: map[string]SubsystemHandler{
+			"sftp": func(s Session) {
+				srv, err := sftp.NewServer(s, sftp.WithServerWorkingDirectory(dir))
+				if err != nil {
+					t.Errorf("sftp.NewServer: %v", err)
+					return
+				}
+				srv.Serve()
+			},
+		},
+	}
+
+	payload := struct{ Name string }{"sftp"}
+	reqs := make(chan *gossh.Request, 1)
+	reqs <- &gossh.Request{Type: "subsystem", Payload: gossh.Marshal(&payload)}
+	close(reqs)
+
+	done := make(chan struct{})
+	go func() {
+		sess.handleRequests(reqs)
+		close(done)
+	}()
+
+	client, err := sftp.NewClientPipe(clientRead, clientWrite)
+	if err != nil {
+		t.Fatalf("sftp.NewClientPipe: %v", err)
+	}
+
+	f, err := client.Create("greeting.txt")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := f.Write([]byte("hello from sftp")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "greeting.txt"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "hello from sftp" {
+		t.Fatalf("file contents = %q, want %q", got, "hello from sftp")
+	}
+
+	client.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handleRequests never returned after the sftp client disconnected")
+	}
+}
+
+// TestSubsystemDispatch drives a "subsystem" request through handleRequests
+// and checks it's routed to the matching handler, with Subsystem() and
+// handled state updated before the handler runs. See
+// TestSubsystemSFTPRoundTrip for the full round trip against
+// github.com/pkg/sftp.
+func TestSubsystemDispatch(t *testing.T) {
+	called := make(chan Session, 1)
+	sess := &session{
+		Channel: &fakeChannel{},
+		subsystemHandlers: map[string]SubsystemHandler{
+			"echo": func(s Session) { called <- s },
+		},
+	}
+
+	payload := struct{ Name string }{"echo"}
+	reqs := make(chan *gossh.Request, 1)
+	reqs <- &gossh.Request{Type: "subsystem", Payload: gossh.Marshal(&payload)}
+	close(reqs)
+	sess.handleRequests(reqs)
+
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("registered subsystem handler was never invoked")
+	}
+
+	if got := sess.Subsystem(); got != "echo" {
+		t.Fatalf("Subsystem() = %q, want %q", got, "echo")
+	}
+	if !sess.handled {
+		t.Fatal("handled should be true after a subsystem request is accepted")
+	}
+}
+
+// TestSubsystemDispatchUnknown checks that a request for an unregistered
+// subsystem is rejected and leaves the session unhandled.
+func TestSubsystemDispatchUnknown(t *testing.T) {
+	sess := &session{subsystemHandlers: map[string]SubsystemHandler{}}
+
+	payload := struct{ Name string }{"sftp"}
+	reqs := make(chan *gossh.Request, 1)
+	reqs <- &gossh.Request{Type: "subsystem", Payload: gossh.Marshal(&payload)}
+	close(reqs)
+	sess.handleRequests(reqs)
+
+	if sess.handled {
+		t.Fatal("handled should stay false for an unregistered subsystem")
+	}
+	if sess.Subsystem() != "" {
+		t.Fatalf("Subsystem() = %q, want empty", sess.Subsystem())
+	}
+}
+
+// TestServerHandle checks that Server.Handle and HandleSubsystem each
+// register a SubsystemHandler under the given name, with Handle lazily
+// creating the map as needed.
+func TestServerHandle(t *testing.T) {
+	srv := &Server{}
+	called := false
+	srv.Handle("echo", func(Session) { called = true })
+
+	h, ok := srv.SubsystemHandlers["echo"]
+	if !ok {
+		t.Fatal("expected Handle to register a handler under \"echo\"")
+	}
+	h(nil)
+	if !called {
+		t.Fatal("expected the registered handler to run")
+	}
+
+	srv.HandleSubsystem("sftp", func(Session) {})
+	if _, ok := srv.SubsystemHandlers["sftp"]; !ok {
+		t.Fatal("expected HandleSubsystem to register a handler under \"sftp\"")
+	}
+}
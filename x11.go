@@ -0,0 +1,54 @@
+package ssh
+
+import gossh "golang.org/x/crypto/ssh"
+
+// X11 describes the parameters of an x11-req channel request, as defined by
+// RFC 4254 Section 6.3.1. AuthCookie is the client-generated
+// MIT-MAGIC-COOKIE-1 value; the server is expected to substitute its own
+// cookie when it proxies data to the client's X11 display, but this package
+// leaves that substitution, and the display forwarding itself, to the
+// caller's X11ChannelHandler.
+type X11 struct {
+	SingleConnection bool
+	AuthProtocol     string
+	AuthCookie       string
+	ScreenNumber     uint32
+}
+
+// parseX11Request unmarshals an x11-req payload into an X11.
+func parseX11Request(payload []byte) (X11, bool) {
+	var x11Req struct {
+		SingleConnection bool
+		AuthProtocol     string
+		AuthCookie       string
+		ScreenNumber     uint32
+	}
+	if err := gossh.Unmarshal(payload, &x11Req); err != nil {
+		return X11{}, false
+	}
+	return X11{
+		SingleConnection: x11Req.SingleConnection,
+		AuthProtocol:     x11Req.AuthProtocol,
+		AuthCookie:       x11Req.AuthCookie,
+		ScreenNumber:     x11Req.ScreenNumber,
+	}, true
+}
+
+// X11ChannelHandler handles an "x11" channel the client opens back to the
+// server once a GUI app wants to talk to the display negotiated by an
+// earlier x11-req. conn and newChan are expected to come straight from
+// whatever loop accepts incoming channels for a connection and type-switches
+// on newChan.ChannelType() — the same place "session" channels are handed to
+// sessionHandler. That loop lives outside this package snapshot, same as
+// sessionHandler's own caller; Server.x11ChannelHandler (see server.go) is
+// the piece of it this package owns: it resolves which X11ChannelHandler a
+// given connection should use, defaulting to RejectX11Channel when none is
+// set.
+type X11ChannelHandler func(srv *Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx Context)
+
+// RejectX11Channel is the X11ChannelHandler behavior Server.x11ChannelHandler
+// falls back to when Server.X11ChannelHandler is nil: it rejects the channel
+// outright, since display forwarding needs an explicit handler.
+func RejectX11Channel(srv *Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx Context) {
+	newChan.Reject(gossh.Prohibited, "x11 forwarding not enabled")
+}
@@ -0,0 +1,108 @@
+package ssh
+
+import (
+	"sync"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func newTestX11Request(t *testing.T, x11 X11) *gossh.Request {
+	t.Helper()
+	payload := struct {
+		SingleConnection bool
+		AuthProtocol     string
+		AuthCookie       string
+		ScreenNumber     uint32
+	}{x11.SingleConnection, x11.AuthProtocol, x11.AuthCookie, x11.ScreenNumber}
+	return &gossh.Request{Type: "x11-req", Payload: gossh.Marshal(&payload)}
+}
+
+func TestX11RequestDeniedByDefault(t *testing.T) {
+	sess := &session{}
+	reqs := make(chan *gossh.Request, 1)
+	reqs <- newTestX11Request(t, X11{AuthProtocol: "MIT-MAGIC-COOKIE-1", AuthCookie: "deadbeef"})
+	close(reqs)
+	sess.handleRequests(reqs)
+
+	if _, ok := sess.X11(); ok {
+		t.Fatal("X11() should report not-accepted when no X11Callback is configured")
+	}
+}
+
+func TestX11RequestDeniedByCallback(t *testing.T) {
+	sess := &session{
+		x11Cb: func(ctx Context, x11 X11) bool { return false },
+	}
+	reqs := make(chan *gossh.Request, 1)
+	reqs <- newTestX11Request(t, X11{AuthProtocol: "MIT-MAGIC-COOKIE-1"})
+	close(reqs)
+	sess.handleRequests(reqs)
+
+	if _, ok := sess.X11(); ok {
+		t.Fatal("X11() should report not-accepted when the callback denies the request")
+	}
+}
+
+func TestX11RequestAccepted(t *testing.T) {
+	want := X11{
+		SingleConnection: true,
+		AuthProtocol:     "MIT-MAGIC-COOKIE-1",
+		AuthCookie:       "deadbeef",
+		ScreenNumber:     1,
+	}
+	sess := &session{
+		x11Cb: func(ctx Context, x11 X11) bool { return true },
+	}
+	reqs := make(chan *gossh.Request, 1)
+	reqs <- newTestX11Request(t, want)
+	close(reqs)
+	sess.handleRequests(reqs)
+
+	got, ok := sess.X11()
+	if !ok {
+		t.Fatal("X11() should report accepted once the callback accepts the request")
+	}
+	if got != want {
+		t.Fatalf("X11() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseX11RequestRejectsGarbage(t *testing.T) {
+	if _, ok := parseX11Request([]byte{0xff}); ok {
+		t.Fatal("parseX11Request should reject a malformed payload")
+	}
+}
+
+// TestX11RequestAfterHandledIsRejected checks that an x11-req arriving
+// after a shell/exec/subsystem request has already claimed the session is
+// rejected rather than raced against: handleRequests runs concurrently
+// with the handler goroutine it started, and without a sess.handled guard
+// here it would keep writing sess.x11/sess.x11Accepted while the handler
+// goroutine concurrently reads them through X11(), a data race go test
+// -race catches.
+func TestX11RequestAfterHandledIsRejected(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	sess := &session{
+		Channel: &fakeChannel{},
+		x11Cb:   func(ctx Context, x11 X11) bool { return true },
+		handler: func(s Session) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				s.X11()
+			}
+		},
+	}
+
+	reqs := make(chan *gossh.Request, 2)
+	reqs <- &gossh.Request{Type: "shell", Payload: gossh.Marshal(&struct{ Value string }{})}
+	reqs <- newTestX11Request(t, X11{AuthProtocol: "MIT-MAGIC-COOKIE-1"})
+	close(reqs)
+	sess.handleRequests(reqs)
+	wg.Wait()
+
+	if _, ok := sess.X11(); ok {
+		t.Fatal("x11-req arriving after the session is handled should be rejected")
+	}
+}